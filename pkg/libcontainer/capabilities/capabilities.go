@@ -0,0 +1,149 @@
+// +build linux
+
+package capabilities
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/dotcloud/docker/pkg/libcontainer"
+	"github.com/syndtr/gocapability/capability"
+)
+
+const procCapLastCap = "/proc/sys/kernel/cap_last_cap"
+
+const (
+	prCapbsetDrop     = 24
+	prCapAmbient      = 47
+	prCapAmbientRaise = 2
+)
+
+// capabilityMap resolves the CAP_* names used in container configs to the
+// capability.Cap values the running kernel knows about. It is built once, at
+// init time, by walking capability.List() up to cap_last_cap.
+var capabilityMap = buildCapabilityMap()
+
+// Drop applies the container's configured bounding, effective, and ambient
+// capability sets to the calling process. It is called from the container's
+// init, as the last privilege-dropping step before the user's command is
+// exec'd, so the user's process never runs with more privilege than the
+// container asked for. The caller must have already locked the calling
+// goroutine to its OS thread, since capability state is per-thread and the
+// syscalls below have to land on the same thread that eventually execs.
+func Drop(container *libcontainer.Container) error {
+	if err := dropBoundingSet(container.CapabilitiesBounding); err != nil {
+		return fmt.Errorf("drop bounding capabilities: %s", err)
+	}
+	if err := setCapabilities(container.CapabilitiesEffective); err != nil {
+		return fmt.Errorf("set capabilities: %s", err)
+	}
+	if err := raiseAmbient(container.CapabilitiesAmbient); err != nil {
+		return fmt.Errorf("raise ambient capabilities: %s", err)
+	}
+	return nil
+}
+
+// dropBoundingSet shrinks the bounding set down to keep, dropping every
+// other capability the kernel supports via PR_CAPBSET_DROP.
+func dropBoundingSet(keep []string) error {
+	kept, err := toCapSet(keep)
+	if err != nil {
+		return err
+	}
+	for name, cap := range capabilityMap {
+		if kept[name] {
+			continue
+		}
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prCapbsetDrop, uintptr(cap), 0); errno != 0 {
+			// EINVAL here means the kernel doesn't implement this cap at all;
+			// nothing to drop.
+			if errno != syscall.EINVAL {
+				return fmt.Errorf("PR_CAPBSET_DROP %s: %s", name, errno)
+			}
+		}
+	}
+	return nil
+}
+
+// setCapabilities sets the permitted, effective, and inheritable sets to
+// exactly the given list via capset(2).
+func setCapabilities(names []string) error {
+	caps, err := toCaps(names)
+	if err != nil {
+		return err
+	}
+	c, err := capability.NewPid(0)
+	if err != nil {
+		return err
+	}
+	c.Clear(capability.CAPS)
+	c.Set(capability.CAPS, caps...)
+	return c.Apply(capability.CAPS)
+}
+
+// raiseAmbient raises each requested capability into the ambient set via
+// prctl(PR_CAP_AMBIENT, PR_CAP_AMBIENT_RAISE, cap). The capability must
+// already be permitted and inheritable, so this always runs after
+// setCapabilities.
+func raiseAmbient(names []string) error {
+	caps, err := toCaps(names)
+	if err != nil {
+		return err
+	}
+	for i, cap := range caps {
+		if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prCapAmbient, prCapAmbientRaise, uintptr(cap), 0, 0, 0); errno != 0 {
+			return fmt.Errorf("PR_CAP_AMBIENT_RAISE %s: %s", names[i], errno)
+		}
+	}
+	return nil
+}
+
+// toCaps resolves a list of CAP_* names to their capability.Cap values,
+// failing loudly on anything the running kernel doesn't recognize.
+func toCaps(names []string) ([]capability.Cap, error) {
+	caps := make([]capability.Cap, 0, len(names))
+	for _, name := range names {
+		cap, exists := capabilityMap[strings.ToUpper(name)]
+		if !exists {
+			return nil, fmt.Errorf("unknown capability %q", name)
+		}
+		caps = append(caps, cap)
+	}
+	return caps, nil
+}
+
+func toCapSet(names []string) (map[string]bool, error) {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		if _, exists := capabilityMap[strings.ToUpper(name)]; !exists {
+			return nil, fmt.Errorf("unknown capability %q", name)
+		}
+		set[strings.ToUpper(name)] = true
+	}
+	return set, nil
+}
+
+// buildCapabilityMap walks every capability the running kernel supports, up
+// to cap_last_cap, and indexes it by its CAP_* name. Older kernels without
+// /proc/sys/kernel/cap_last_cap fall back to CAP_BLOCK_SUSPEND, the last
+// capability defined before that file existed.
+func buildCapabilityMap() map[string]capability.Cap {
+	last := capability.CAP_BLOCK_SUSPEND
+	if b, err := ioutil.ReadFile(procCapLastCap); err == nil {
+		if n, err := strconv.Atoi(strings.TrimSpace(string(b))); err == nil {
+			last = capability.Cap(n)
+		}
+	}
+
+	m := map[string]capability.Cap{}
+	for _, cap := range capability.List() {
+		if cap > last {
+			continue
+		}
+		m["CAP_"+strings.ToUpper(cap.String())] = cap
+	}
+	return m
+}
@@ -0,0 +1,29 @@
+// +build linux
+
+package fs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+
+	"github.com/dotcloud/docker/pkg/libcontainer/cgroups"
+)
+
+// Join writes pid into the tasks file of every cgroup subsystem the
+// container already has set up, without creating or reconfiguring anything.
+// It is used to attach a second process -- e.g. a `docker exec` session --
+// to a container's existing cgroups.
+func Join(c *cgroups.Cgroup, pid int) error {
+	paths, err := GetPaths(c)
+	if err != nil {
+		return err
+	}
+	for subsystem, path := range paths {
+		if err := ioutil.WriteFile(filepath.Join(path, "tasks"), []byte(strconv.Itoa(pid)), 0700); err != nil {
+			return fmt.Errorf("join %s cgroup: %s", subsystem, err)
+		}
+	}
+	return nil
+}
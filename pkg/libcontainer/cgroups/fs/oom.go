@@ -0,0 +1,82 @@
+// +build linux
+
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/dotcloud/docker/pkg/libcontainer/cgroups"
+)
+
+// ErrMemorySubsystemNotMounted is returned by NotifyOnOOM when the container
+// has no memory cgroup to listen for OOM events on.
+var ErrMemorySubsystemNotMounted = errors.New("memory cgroup subsystem not mounted")
+
+type oomCloser struct {
+	eventfd *os.File
+}
+
+func (o *oomCloser) Close() error {
+	return o.eventfd.Close()
+}
+
+// NotifyOnOOM registers an eventfd listener on the container's
+// memory.oom_control and returns a channel that receives a value every time
+// the kernel reports the container hit its memory limit, along with a
+// Closer that tears the listener down.
+func NotifyOnOOM(c *cgroups.Cgroup) (<-chan struct{}, io.Closer, error) {
+	paths, err := GetPaths(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	memoryPath, ok := paths["memory"]
+	if !ok {
+		return nil, nil, ErrMemorySubsystemNotMounted
+	}
+
+	oomControl, err := os.Open(filepath.Join(memoryPath, "memory.oom_control"))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer oomControl.Close()
+
+	eventfd, err := newEventfd()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data := fmt.Sprintf("%d %d", eventfd.Fd(), oomControl.Fd())
+	eventControlPath := filepath.Join(memoryPath, "cgroup.event_control")
+	if err := ioutil.WriteFile(eventControlPath, []byte(data), 0700); err != nil {
+		eventfd.Close()
+		return nil, nil, fmt.Errorf("register oom listener: %s", err)
+	}
+
+	ch := make(chan struct{})
+	go func() {
+		buf := make([]byte, 8)
+		for {
+			if _, err := eventfd.Read(buf); err != nil {
+				close(ch)
+				return
+			}
+			ch <- struct{}{}
+		}
+	}()
+
+	return ch, &oomCloser{eventfd: eventfd}, nil
+}
+
+func newEventfd() (*os.File, error) {
+	fd, _, errno := syscall.RawSyscall(syscall.SYS_EVENTFD2, 0, 0, 0)
+	if errno != 0 {
+		return nil, fmt.Errorf("eventfd: %s", errno)
+	}
+	return os.NewFile(fd, "oom-eventfd"), nil
+}
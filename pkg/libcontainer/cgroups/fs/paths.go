@@ -0,0 +1,39 @@
+// +build linux
+
+package fs
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/dotcloud/docker/pkg/libcontainer/cgroups"
+)
+
+var subsystems = []string{
+	"devices",
+	"memory",
+	"cpu",
+	"cpuset",
+	"cpuacct",
+	"blkio",
+	"freezer",
+}
+
+// GetPaths resolves the on-disk cgroup directory for every subsystem the
+// container has a cgroup in, keyed by subsystem name.
+func GetPaths(c *cgroups.Cgroup) (map[string]string, error) {
+	paths := make(map[string]string)
+	for _, subsystem := range subsystems {
+		mountpoint, err := cgroups.FindCgroupMountpoint(subsystem)
+		if err != nil {
+			// Not every subsystem is mounted on every host; skip it the same
+			// way Apply does.
+			continue
+		}
+		paths[subsystem] = filepath.Join(mountpoint, c.Name)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no cgroup subsystems mounted")
+	}
+	return paths, nil
+}
@@ -0,0 +1,15 @@
+// +build linux
+
+package systemd
+
+import (
+	"github.com/dotcloud/docker/pkg/libcontainer/cgroups"
+	"github.com/dotcloud/docker/pkg/libcontainer/cgroups/fs"
+)
+
+// Join attaches pid to a container's existing systemd-managed cgroups. The
+// directories are the same cgroupfs paths fs.Join writes to; systemd just
+// owns the unit that created them.
+func Join(c *cgroups.Cgroup, pid int) error {
+	return fs.Join(c, pid)
+}
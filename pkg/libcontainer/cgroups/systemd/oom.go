@@ -0,0 +1,17 @@
+// +build linux
+
+package systemd
+
+import (
+	"io"
+
+	"github.com/dotcloud/docker/pkg/libcontainer/cgroups"
+	"github.com/dotcloud/docker/pkg/libcontainer/cgroups/fs"
+)
+
+// NotifyOnOOM registers for OOM events on a container's systemd-managed
+// memory cgroup. It is the same eventfd listener fs.NotifyOnOOM uses, since
+// systemd doesn't change the memory.oom_control/cgroup.event_control layout.
+func NotifyOnOOM(c *cgroups.Cgroup) (<-chan struct{}, io.Closer, error) {
+	return fs.NotifyOnOOM(c)
+}
@@ -4,6 +4,7 @@ package namespaces
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
@@ -19,13 +20,21 @@ import (
 
 // Exec performes setup outside of a namespace so that a container can be
 // executed.  Exec is a high level function for working with container namespaces.
-func Exec(container *libcontainer.Container, term Terminal, rootfs, dataPath string, args []string, createCommand CreateCommand, startCallback func()) (int, error) {
+//
+// oomCallback, if non-nil, is invoked on its own goroutine every time the
+// kernel reports the container's memory cgroup hit its limit; the caller
+// decides whether to log it, restart the container, or kill it.
+func Exec(container *libcontainer.Container, term Terminal, rootfs, dataPath string, args []string, createCommand CreateCommand, startCallback func(), oomCallback func()) (int, error) {
 	var (
 		master  *os.File
 		console string
 		err     error
 	)
 
+	if err := network.Validate(container.Networks); err != nil {
+		return -1, err
+	}
+
 	// create a pipe so that we can syncronize with the namespaced process and
 	// pass the veth name to the child
 	syncPipe, err := NewSyncPipe()
@@ -51,6 +60,15 @@ func Exec(container *libcontainer.Container, term Terminal, rootfs, dataPath str
 	if err := command.Start(); err != nil {
 		return -1, err
 	}
+	defer syncPipe.CloseParent()
+
+	// The child now has its own copy of the child end via ExtraFiles; close
+	// ours so it doesn't linger, duplicated, in the daemon itself.
+	if err := syncPipe.CloseChild(); err != nil {
+		command.Process.Kill()
+		command.Wait()
+		return -1, err
+	}
 
 	started, err := system.GetProcessStartTime(command.Process.Pid)
 	if err != nil {
@@ -67,6 +85,7 @@ func Exec(container *libcontainer.Container, term Terminal, rootfs, dataPath str
 	// can escape the cgroup
 	cleaner, err := SetupCgroups(container, command.Process.Pid)
 	if err != nil {
+		syncPipe.ReportChildError(err)
 		command.Process.Kill()
 		command.Wait()
 		return -1, err
@@ -74,16 +93,41 @@ func Exec(container *libcontainer.Container, term Terminal, rootfs, dataPath str
 	if cleaner != nil {
 		defer cleaner.Cleanup()
 	}
+	if err := syncPipe.SendCgroupReady(); err != nil {
+		command.Process.Kill()
+		command.Wait()
+		return -1, err
+	}
+
+	if oomCallback != nil {
+		oomChan, oomCloser, err := NotifyOnOOM(container)
+		if err != nil {
+			command.Process.Kill()
+			command.Wait()
+			return -1, err
+		}
+		defer oomCloser.Close()
+		go func() {
+			for range oomChan {
+				oomCallback()
+			}
+		}()
+	}
 
 	if err := InitializeNetworking(container, command.Process.Pid, syncPipe); err != nil {
+		syncPipe.ReportChildError(err)
 		command.Process.Kill()
 		command.Wait()
 		return -1, err
 	}
-	defer TeardownNetworking(container, command.Process.Pid, syncPipe)
+	defer TeardownNetworking(container, command.Process.Pid)
 
-	// Sync with child
-	syncPipe.Close()
+	// Tell the child its setup is complete and it's clear to execve.
+	if err := syncPipe.SendProceed(); err != nil {
+		command.Process.Kill()
+		command.Wait()
+		return -1, err
+	}
 
 	if startCallback != nil {
 		startCallback()
@@ -131,7 +175,7 @@ func DefaultCreateCommand(container *libcontainer.Container, console, rootfs, da
 	command.Dir = rootfs
 	command.Env = append(os.Environ(), env...)
 
-	system.SetCloneFlags(command, uintptr(GetNamespaceFlags(container.Namespaces)))
+	system.SetCloneFlags(command, uintptr(GetNamespaceFlags(container)))
 	command.SysProcAttr.Pdeathsig = syscall.SIGKILL
 	command.ExtraFiles = []*os.File{pipe}
 
@@ -151,6 +195,36 @@ func SetupCgroups(container *libcontainer.Container, nspid int) (cgroups.ActiveC
 	return nil, nil
 }
 
+// JoinCgroups attaches pid to a container's already-configured cgroups, without
+// creating or reconfiguring anything. It is used by ExecIn to put a second
+// process, such as a `docker exec` session, into the same cgroups as the
+// container's init.
+func JoinCgroups(container *libcontainer.Container, pid int) error {
+	if container.Cgroups == nil {
+		return nil
+	}
+	if systemd.UseSystemd() {
+		return systemd.Join(container.Cgroups, pid)
+	}
+	return fs.Join(container.Cgroups, pid)
+}
+
+// NotifyOnOOM registers for the container's memory cgroup OOM events. The
+// returned channel receives a value every time the kernel reports the
+// container's memory cgroup hit its limit; the Closer tears the listener
+// down. It returns an error, rather than panicking, if the container has no
+// cgroups configured, and fs.ErrMemorySubsystemNotMounted if the memory
+// subsystem isn't mounted.
+func NotifyOnOOM(container *libcontainer.Container) (<-chan struct{}, io.Closer, error) {
+	if container.Cgroups == nil {
+		return nil, nil, fmt.Errorf("no cgroups configured for container")
+	}
+	if systemd.UseSystemd() {
+		return systemd.NotifyOnOOM(container.Cgroups)
+	}
+	return fs.NotifyOnOOM(container.Cgroups)
+}
+
 // InitializeNetworking creates the container's network stack outside of the namespace and moves
 // interfaces into the container's net namespaces if necessary
 func InitializeNetworking(container *libcontainer.Container, nspid int, pipe *SyncPipe) error {
@@ -164,68 +238,38 @@ func InitializeNetworking(container *libcontainer.Container, nspid int, pipe *Sy
 			return err
 		}
 	}
-	for _, net_iface := range container.NetworkInterfaces {
-		log.Printf("setting up %+v", net_iface)
-		if err := network.InterfaceDown(net_iface.HostIfaceName); err != nil {
-			log.Printf("interface down failed for %s", net_iface.HostIfaceName)
-		}
-		if err := network.SetInterfaceInNamespacePid(net_iface.HostIfaceName, nspid); err != nil {
-			log.Printf("failed to set interface into namespace pid of %d, named %s", nspid, net_iface.HostIfaceName)
-			log.Printf("error was %+v", err)
-		}
-		if err := network.InterfaceUp(net_iface.HostIfaceName); err != nil {
-			log.Printf("interface up failed for %s", net_iface.HostIfaceName)
-		}
-	}
-	return pipe.SendToChild(context)
+	return pipe.SendNetworkReady(context)
 }
 
-func TeardownNetworking(container *libcontainer.Container, nspid int, pipe *SyncPipe) {
-	original, err := os.OpenFile("/proc/self/net/ns", os.O_RDONLY, 0)
-	if err != nil {
-		log.Printf("unable to open self proc %+v", err)
-	} else {
-		defer func() {
-			if err := system.Setns(original.Fd(), 0); err != nil {
-				log.Printf("unable to set ns to self proc %+v", err)
-			}
-		}()
-	}
-
-	running, err := os.OpenFile(fmt.Sprintf("/proc/%d/net/ns", nspid), os.O_RDONLY, 0)
-	if err != nil {
-		log.Printf("unable to open %d proc %+v", nspid, err)
-		//return
-	}
-	if err := system.Setns(running.Fd(), 0); err != nil {
-		log.Printf("unable to set ns to pid proc %+v", err)
-		//return
-	}
-	log.Printf("namespace set to pid")
-	for _, net_iface := range container.NetworkInterfaces {
-		log.Printf("tearing down %+v", net_iface)
-		if err := network.InterfaceDown(net_iface.HostIfaceName); err != nil {
-			log.Printf("interface down failed for %s", net_iface.HostIfaceName)
-		}
-		if err := network.SetInterfaceInNamespacePid(net_iface.HostIfaceName, 1); err != nil {
-			log.Printf("failed to set interface into namespace pid of %d, named %s", nspid, net_iface.HostIfaceName)
-			log.Printf("unable to set interface namespace pid %+v", err)
+// TeardownNetworking reverses InitializeNetworking by asking each configured
+// network's strategy to undo whatever it set up.
+func TeardownNetworking(container *libcontainer.Container, nspid int) {
+	for _, config := range container.Networks {
+		strategy, err := network.GetStrategy(config.Type)
+		if err != nil {
+			log.Printf("unknown network type %q during teardown: %s", config.Type, err)
+			continue
 		}
-		if err := network.InterfaceUp(net_iface.HostIfaceName); err != nil {
-			log.Printf("interface up failed for %s", net_iface.HostIfaceName)
+		if err := strategy.Destroy(config, nspid); err != nil {
+			log.Printf("tearing down %s network failed: %s", config.Type, err)
 		}
 	}
 }
 
 // GetNamespaceFlags parses the container's Namespaces options to set the correct
-// flags on clone, unshare, and setns
-func GetNamespaceFlags(namespaces map[string]bool) (flag int) {
-	for key, enabled := range namespaces {
+// flags on clone, unshare, and setns. A configured "netns" network strategy drops
+// CLONE_NEWNET so the child joins the existing namespace recorded by that strategy
+// instead of getting a fresh one.
+func GetNamespaceFlags(container *libcontainer.Container) (flag int) {
+	for key, enabled := range container.Namespaces {
 		if enabled {
 			if ns := libcontainer.GetNamespace(key); ns != nil {
 				flag |= ns.Value
 			}
 		}
 	}
+	if network.UsesExistingNetworkNamespace(container.Networks) {
+		flag &^= syscall.CLONE_NEWNET
+	}
 	return flag
 }
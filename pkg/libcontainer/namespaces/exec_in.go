@@ -0,0 +1,139 @@
+// +build linux
+
+package namespaces
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"syscall"
+
+	"github.com/dotcloud/docker/pkg/libcontainer"
+	"github.com/dotcloud/docker/pkg/libcontainer/capabilities"
+	"github.com/dotcloud/docker/pkg/system"
+)
+
+// namespacesToEnter lists the namespace files FinalizeSetns joins from
+// inside the forked child, in order. mnt is last because it pivots the
+// filesystem everything after it -- chroot, cgroups, capabilities -- runs
+// against.
+var namespacesToEnter = []string{"ipc", "uts", "net", "mnt"}
+
+// ExecIn runs args inside the namespaces of the already-running container
+// identified by nspid, without creating any new CLONE_NEW* namespaces of its
+// own. This is what backs `docker exec`.
+func ExecIn(container *libcontainer.Container, nspid int, args []string) (int, error) {
+	// setns(CLONE_NEWPID) only affects children forked by the calling OS
+	// thread afterwards, and command.Start() below has to fork from that
+	// same thread -- otherwise the Go scheduler could run the fork on a
+	// thread that never joined the target pid namespace. Lock here and
+	// leave it locked: this thread now belongs to a different pid
+	// namespace than the rest of the process and must never be handed back
+	// to the scheduler for other goroutines to run on.
+	runtime.LockOSThread()
+
+	// The pid namespace has to be joined here, before we fork, since
+	// setns(CLONE_NEWPID) only takes effect for children created after the
+	// call -- the calling process itself stays in its current pid
+	// namespace. Every other namespace is joined from inside the child.
+	pidFd, err := os.Open(fmt.Sprintf("/proc/%d/ns/pid", nspid))
+	if err != nil {
+		return -1, fmt.Errorf("open pid namespace: %s", err)
+	}
+	defer pidFd.Close()
+	if err := system.Setns(pidFd.Fd(), 0); err != nil {
+		return -1, fmt.Errorf("setns pid: %s", err)
+	}
+
+	errorPipeRead, errorPipeWrite, err := os.Pipe()
+	if err != nil {
+		return -1, err
+	}
+
+	command := exec.Command("/proc/self/exe", append([]string{"nsenter", strconv.Itoa(nspid)}, args...)...)
+	command.ExtraFiles = []*os.File{errorPipeWrite}
+	command.SysProcAttr = &syscall.SysProcAttr{Pdeathsig: syscall.SIGKILL}
+
+	if err := command.Start(); err != nil {
+		errorPipeWrite.Close()
+		errorPipeRead.Close()
+		return -1, fmt.Errorf("start nsenter: %s", err)
+	}
+	errorPipeWrite.Close()
+
+	// The child reports setup failures over the error pipe before it execs
+	// anything; a clean exec closes its end without writing.
+	setupErr, err := ioutil.ReadAll(errorPipeRead)
+	errorPipeRead.Close()
+	if err != nil {
+		command.Process.Kill()
+		command.Wait()
+		return -1, fmt.Errorf("read nsenter handshake: %s", err)
+	}
+	if len(setupErr) > 0 {
+		command.Wait()
+		return -1, fmt.Errorf("nsenter setup: %s", setupErr)
+	}
+
+	if err := command.Wait(); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return -1, err
+		}
+	}
+	return command.ProcessState.Sys().(syscall.WaitStatus).ExitStatus(), nil
+}
+
+// FinalizeSetns is run by the forked child, re-exec'd as `<binary> nsenter
+// <nspid> <args...>`. It joins the remaining namespaces, chroots into the
+// container's existing rootfs, attaches itself to the container's existing
+// cgroups, drops capabilities, and execs args. Any failure along the way is
+// written to errorPipe so ExecIn can surface it before it execs anything.
+func FinalizeSetns(container *libcontainer.Container, nspid int, rootfs string, errorPipe *os.File, args []string) error {
+	// setns and capability state are per-OS-thread; pin this goroutine to
+	// its current thread so the Go scheduler can't move it elsewhere
+	// between here and the final exec, which would leave the thread that
+	// actually execs still sitting in the wrong namespace or the wrong
+	// capability set. This goroutine execs or dies below, so it's never
+	// unlocked.
+	runtime.LockOSThread()
+
+	fail := func(err error) error {
+		fmt.Fprint(errorPipe, err.Error())
+		errorPipe.Close()
+		return err
+	}
+
+	for _, name := range namespacesToEnter {
+		fd, err := os.Open(fmt.Sprintf("/proc/%d/ns/%s", nspid, name))
+		if err != nil {
+			return fail(fmt.Errorf("open %s namespace: %s", name, err))
+		}
+		err = system.Setns(fd.Fd(), 0)
+		fd.Close()
+		if err != nil {
+			return fail(fmt.Errorf("setns %s: %s", name, err))
+		}
+	}
+
+	if err := syscall.Chroot(rootfs); err != nil {
+		return fail(fmt.Errorf("chroot: %s", err))
+	}
+	if err := syscall.Chdir("/"); err != nil {
+		return fail(fmt.Errorf("chdir: %s", err))
+	}
+
+	if err := JoinCgroups(container, os.Getpid()); err != nil {
+		return fail(err)
+	}
+
+	if err := capabilities.Drop(container); err != nil {
+		return fail(fmt.Errorf("drop capabilities: %s", err))
+	}
+
+	errorPipe.Close()
+
+	return syscall.Exec(args[0], args, os.Environ())
+}
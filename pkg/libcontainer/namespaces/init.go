@@ -0,0 +1,81 @@
+// +build linux
+
+package namespaces
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+
+	"github.com/dotcloud/docker/pkg/libcontainer"
+	"github.com/dotcloud/docker/pkg/libcontainer/capabilities"
+	"github.com/dotcloud/docker/pkg/libcontainer/network"
+	"github.com/dotcloud/docker/pkg/system"
+)
+
+// Init is run as the container's pid 1, re-exec'd by DefaultCreateCommand as
+// `<binary> init`. It finishes the parts of namespace setup that can only
+// happen from inside the new namespaces -- joining a foreign netns,
+// bringing up interfaces -- and then execs the user's command.
+func Init(container *libcontainer.Container, syncPipe *SyncPipe, args []string) error {
+	// setns and capability state are per-OS-thread; pin this goroutine to
+	// its current thread so the Go scheduler can't move it elsewhere
+	// between here and the final exec, which would leave the thread that
+	// actually execs still sitting in the wrong namespace or the wrong
+	// capability set. The goroutine execs or dies below, so it's never
+	// unlocked.
+	runtime.LockOSThread()
+
+	ctx, err := syncPipe.ReadFromParent()
+	if err != nil {
+		return err
+	}
+
+	if nsPath := ctx["netns_path"]; nsPath != "" {
+		if err := JoinExistingNamespace(nsPath); err != nil {
+			return err
+		}
+	}
+
+	for _, config := range container.Networks {
+		strategy, err := network.GetStrategy(config.Type)
+		if err != nil {
+			return err
+		}
+		if err := strategy.Initialize(config, ctx); err != nil {
+			return err
+		}
+	}
+
+	// Capabilities are dropped last, immediately before exec, so the user's
+	// process never runs with more privilege than the container is
+	// configured to keep.
+	if err := capabilities.Drop(container); err != nil {
+		return fmt.Errorf("drop capabilities: %s", err)
+	}
+
+	// The sync pipe has done its job; close it rather than let the user's
+	// process inherit a live socket into the daemon.
+	if err := syncPipe.CloseChild(); err != nil {
+		return fmt.Errorf("close sync pipe: %s", err)
+	}
+
+	return syscall.Exec(args[0], args, os.Environ())
+}
+
+// JoinExistingNamespace opens the namespace file at path and setns(2)s the
+// calling process into it, e.g. so a container can share its network
+// namespace with another container or with the host.
+func JoinExistingNamespace(path string) error {
+	fd, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open namespace %s: %s", path, err)
+	}
+	defer fd.Close()
+
+	if err := system.Setns(fd.Fd(), syscall.CLONE_NEWNET); err != nil {
+		return fmt.Errorf("setns %s: %s", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+// +build linux
+
+package namespaces
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+
+	"github.com/dotcloud/docker/pkg/libcontainer"
+)
+
+// Kind identifies what a Message on the sync pipe represents.
+type Kind string
+
+const (
+	KindNetworkReady Kind = "network-ready"
+	KindCgroupReady  Kind = "cgroup-ready"
+	KindChildError   Kind = "child-error"
+	KindProceed      Kind = "proceed"
+)
+
+// Message is the envelope exchanged over the sync pipe. Data carries
+// kind-specific payload, e.g. the libcontainer.Context for network-ready.
+type Message struct {
+	Kind Kind            `json:"kind"`
+	Err  string          `json:"err,omitempty"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// SyncPipe is a framed JSON protocol carried over fd 3 between the parent
+// and the container's init process. Each message on the wire is a
+// little-endian uint32 length followed by that many bytes of JSON-encoded
+// Message; messages carry no version number. Framing the messages, rather than parsing a
+// positional bag of strings, lets us add new setup phases -- capabilities,
+// seccomp, user-ns uid_map writes -- without breaking wire compatibility,
+// and lets the child block on an explicit "proceed" instead of racing the
+// parent on pipe.Close().
+type SyncPipe struct {
+	parent, child *os.File
+}
+
+// NewSyncPipe creates the connected fd pair used to carry the protocol;
+// child is handed to the container's init process as fd 3.
+func NewSyncPipe() (*SyncPipe, error) {
+	// SOCK_CLOEXEC is defense in depth: both ends are also closed explicitly
+	// on their respective sides of the fork (CloseParent in the parent,
+	// CloseChild in the child before exec), but setting it here means a
+	// future call site that forgets to close its end still won't leak the
+	// fd into whatever gets exec'd.
+	fds, err := syscall.Socketpair(syscall.AF_LOCAL, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &SyncPipe{
+		parent: os.NewFile(uintptr(fds[1]), "sync-parent"),
+		child:  os.NewFile(uintptr(fds[0]), "sync-child"),
+	}, nil
+}
+
+// SendCgroupReady tells the child that its cgroups are fully configured.
+func (s *SyncPipe) SendCgroupReady() error {
+	return writeMessage(s.parent, Message{Kind: KindCgroupReady})
+}
+
+// SendNetworkReady tells the child that its network is configured and
+// passes along whatever context the network strategies recorded for it,
+// e.g. a netns path to join or a veth name to rename.
+func (s *SyncPipe) SendNetworkReady(ctx libcontainer.Context) error {
+	data, err := json.Marshal(ctx)
+	if err != nil {
+		return err
+	}
+	return writeMessage(s.parent, Message{Kind: KindNetworkReady, Data: data})
+}
+
+// SendProceed unblocks the child to exec the user's command. It replaces
+// the old pattern of closing the pipe as the "go ahead" signal.
+func (s *SyncPipe) SendProceed() error {
+	return writeMessage(s.parent, Message{Kind: KindProceed})
+}
+
+// ReportChildError tells the child that the parent's setup failed, so it
+// can exit nonzero instead of executing the user's command.
+func (s *SyncPipe) ReportChildError(cause error) error {
+	return writeMessage(s.parent, Message{Kind: KindChildError, Err: cause.Error()})
+}
+
+// CloseParent closes the parent's end of the pipe.
+func (s *SyncPipe) CloseParent() error {
+	return s.parent.Close()
+}
+
+// CloseChild closes the child's end of the pipe.
+func (s *SyncPipe) CloseChild() error {
+	return s.child.Close()
+}
+
+// ReadFromParent blocks, collecting setup messages from the parent, until it
+// receives "proceed", and returns the libcontainer.Context assembled along
+// the way from any network-ready message. If the parent reports a setup
+// failure via child-error, ReadFromParent returns that error and the caller
+// must exit without executing the user's command.
+func (s *SyncPipe) ReadFromParent() (libcontainer.Context, error) {
+	ctx := libcontainer.Context{}
+	for {
+		m, err := readMessage(s.child)
+		if err != nil {
+			return nil, fmt.Errorf("read sync pipe: %s", err)
+		}
+		switch m.Kind {
+		case KindNetworkReady:
+			if len(m.Data) > 0 {
+				if err := json.Unmarshal(m.Data, &ctx); err != nil {
+					return nil, fmt.Errorf("decode network-ready: %s", err)
+				}
+			}
+		case KindCgroupReady:
+			// Nothing to record; cgroups are configured entirely from the
+			// parent side before the child ever sees this message.
+		case KindChildError:
+			return nil, fmt.Errorf("%s", m.Err)
+		case KindProceed:
+			return ctx, nil
+		default:
+			// Skip kinds this side doesn't know, so a parent can add new
+			// setup phases without breaking an older child.
+		}
+	}
+}
+
+func writeMessage(w io.Writer, m Message) error {
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	header := make([]byte, 4)
+	binary.LittleEndian.PutUint32(header, uint32(len(payload)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err = w.Write(payload)
+	return err
+}
+
+func readMessage(r io.Reader) (Message, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return Message{}, err
+	}
+	payload := make([]byte, binary.LittleEndian.Uint32(header))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return Message{}, err
+	}
+	var m Message
+	if err := json.Unmarshal(payload, &m); err != nil {
+		return Message{}, err
+	}
+	return m, nil
+}
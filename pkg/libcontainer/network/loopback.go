@@ -0,0 +1,21 @@
+package network
+
+import (
+	"github.com/dotcloud/docker/pkg/libcontainer"
+)
+
+// loopback brings the loopback interface up inside a container's network
+// namespace. There is no host-side setup and nothing to tear down.
+type loopback struct{}
+
+func (l *loopback) Create(config *Network, nspid int, ctx libcontainer.Context) error {
+	return nil
+}
+
+func (l *loopback) Initialize(config *Network, ctx libcontainer.Context) error {
+	return InterfaceUp("lo")
+}
+
+func (l *loopback) Destroy(config *Network, nspid int) error {
+	return nil
+}
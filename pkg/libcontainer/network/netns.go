@@ -0,0 +1,36 @@
+package network
+
+import (
+	"fmt"
+
+	"github.com/dotcloud/docker/pkg/libcontainer"
+)
+
+// netns joins a container into a network namespace that already exists
+// instead of asking the kernel to create a fresh one. It is what backs
+// --net=container:other (NsPath=/proc/<pid>/ns/net of the other container)
+// and --net=host (NsPath=/proc/1/ns/net).
+type netns struct{}
+
+func (n *netns) Create(config *Network, nspid int, ctx libcontainer.Context) error {
+	if config.NsPath == "" {
+		return fmt.Errorf("netns strategy requires NsPath")
+	}
+	// There is nothing to set up on the host side; just hand the namespace
+	// path through to the child so it can join it before execve.
+	ctx["netns_path"] = config.NsPath
+	return nil
+}
+
+func (n *netns) Initialize(config *Network, ctx libcontainer.Context) error {
+	// The setns(CLONE_NEWNET) itself happens earlier in the child, in
+	// namespaces.Init, since it has to run before any other namespaced
+	// setup that depends on the final network namespace.
+	return nil
+}
+
+func (n *netns) Destroy(config *Network, nspid int) error {
+	// Nothing to tear down; the namespace being joined is owned by whoever
+	// created it, not by this container.
+	return nil
+}
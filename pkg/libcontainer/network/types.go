@@ -0,0 +1,115 @@
+package network
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/dotcloud/docker/pkg/libcontainer"
+)
+
+// Network describes the configuration for a single network attached to a
+// container. Type selects which Strategy configures and tears it down.
+type Network struct {
+	Type string `json:"type"`
+
+	// NsPath is the path to an existing network namespace to join, e.g.
+	// /proc/<pid>/ns/net or a bind-mounted namespace file. Only consumed by
+	// the "netns" strategy.
+	NsPath string `json:"ns_path,omitempty"`
+
+	// Bridge, Mtu, and Gateway configure the "veth" strategy: the bridge the
+	// host end is attached to, the MTU set on the container's eth0, and the
+	// default route installed inside the container.
+	Bridge  string `json:"bridge,omitempty"`
+	Mtu     int    `json:"mtu,omitempty"`
+	Gateway string `json:"gateway,omitempty"`
+
+	// Allocator hands out and reclaims the address the "veth" strategy
+	// assigns to the container. It is not serialized; callers set it on the
+	// in-memory config before Create runs, so the network package never
+	// owns any allocation state of its own.
+	Allocator Allocator `json:"-"`
+
+	// VethHost, VethChild, and Address are filled in by the "veth"
+	// strategy's Create step; its Destroy reads Address back to release the
+	// IP. They have no meaning for other strategies.
+	VethHost  string `json:"-"`
+	VethChild string `json:"-"`
+	Address   string `json:"-"`
+}
+
+// Allocator hands out and reclaims IPs for veth interfaces. Implementations
+// decide how allocations are persisted (e.g. a bitmap per bridge); the
+// network package keeps no state of its own.
+type Allocator interface {
+	RequestIP(bridge string) (net.IP, *net.IPNet, error)
+	ReleaseIP(ip net.IP) error
+}
+
+// Strategy represents a specific network configuration and is used to
+// configure, initialize, and tear down a container's network interface.
+type Strategy interface {
+	// Create performs any host side setup for the network interface and
+	// records whatever the container's child process will need into ctx.
+	Create(config *Network, nspid int, ctx libcontainer.Context) error
+
+	// Initialize runs inside the container's namespaces, after the clone but
+	// before the user's command is exec'd.
+	Initialize(config *Network, ctx libcontainer.Context) error
+
+	// Destroy reverses the effects of Create, once the container is gone.
+	Destroy(config *Network, nspid int) error
+}
+
+var strategies = map[string]Strategy{
+	"netns":    &netns{},
+	"loopback": &loopback{},
+	"veth":     &veth{},
+}
+
+// GetStrategy returns the registered network strategy for the given type.
+func GetStrategy(typ string) (Strategy, error) {
+	s, exists := strategies[typ]
+	if !exists {
+		return nil, fmt.Errorf("unknown network type %q", typ)
+	}
+	return s, nil
+}
+
+// UsesExistingNetworkNamespace reports whether any of the container's
+// configured networks join a pre-existing namespace rather than asking the
+// kernel to create a fresh one, e.g. --net=container:other or --net=host.
+func UsesExistingNetworkNamespace(networks []*Network) bool {
+	for _, n := range networks {
+		if n.Type == "netns" {
+			return true
+		}
+	}
+	return false
+}
+
+// usesVethStrategy reports whether any of the container's configured
+// networks is a "veth" attachment.
+func usesVethStrategy(networks []*Network) bool {
+	for _, n := range networks {
+		if n.Type == "veth" {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate rejects network configurations namespaces.Exec can't set up
+// correctly. In particular, "netns" and "veth" can't be configured on the
+// same container: a configured "netns" strategy drops CLONE_NEWNET from the
+// clone flags (see namespaces.GetNamespaceFlags) so the child joins the
+// namespace it's pointed at instead of getting a fresh one, but veth's
+// Create step moves the container's interface into the namespace the child
+// is cloned into, by pid, before that setns happens. The two strategies
+// would race over which namespace actually ends up with the interface.
+func Validate(networks []*Network) error {
+	if UsesExistingNetworkNamespace(networks) && usesVethStrategy(networks) {
+		return fmt.Errorf("cannot configure both a netns and a veth network on the same container")
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package network
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net"
+
+	"github.com/dotcloud/docker/pkg/libcontainer"
+)
+
+// veth creates a host/container veth pair, attaches the host end to a
+// bridge, and hands the container end into the new network namespace, where
+// it is renamed to eth0, addressed from config.Allocator, and given an MTU
+// and default route.
+type veth struct{}
+
+func (v *veth) Create(config *Network, nspid int, ctx libcontainer.Context) error {
+	if config.Bridge == "" {
+		return fmt.Errorf("veth strategy requires a bridge")
+	}
+	if config.Allocator == nil {
+		return fmt.Errorf("veth strategy requires an IP allocator")
+	}
+
+	hostName, childName, err := vethPairNames()
+	if err != nil {
+		return err
+	}
+	if err := CreateVethPair(hostName, childName); err != nil {
+		return fmt.Errorf("create veth pair: %s", err)
+	}
+	if err := SetInterfaceMaster(hostName, config.Bridge); err != nil {
+		return fmt.Errorf("attach %s to bridge %s: %s", hostName, config.Bridge, err)
+	}
+	if err := InterfaceUp(hostName); err != nil {
+		return fmt.Errorf("bring up %s: %s", hostName, err)
+	}
+	if err := SetInterfaceInNamespacePid(childName, nspid); err != nil {
+		return fmt.Errorf("move %s into namespace: %s", childName, err)
+	}
+
+	ip, ipNet, err := config.Allocator.RequestIP(config.Bridge)
+	if err != nil {
+		return fmt.Errorf("allocate ip on %s: %s", config.Bridge, err)
+	}
+	ones, _ := ipNet.Mask.Size()
+	address := fmt.Sprintf("%s/%d", ip.String(), ones)
+
+	config.VethHost = hostName
+	config.VethChild = childName
+	config.Address = address
+
+	ctx["veth_child"] = childName
+	ctx["veth_address"] = address
+	return nil
+}
+
+func (v *veth) Initialize(config *Network, ctx libcontainer.Context) error {
+	child := ctx["veth_child"]
+	if child == "" {
+		return fmt.Errorf("no veth interface found in the network context")
+	}
+	if err := ChangeInterfaceName(child, "eth0"); err != nil {
+		return fmt.Errorf("rename %s to eth0: %s", child, err)
+	}
+	if address := ctx["veth_address"]; address != "" {
+		if err := SetInterfaceIp("eth0", address); err != nil {
+			return fmt.Errorf("set eth0 address: %s", err)
+		}
+	}
+	if config.Mtu > 0 {
+		if err := SetMtu("eth0", config.Mtu); err != nil {
+			return fmt.Errorf("set eth0 mtu: %s", err)
+		}
+	}
+	if err := InterfaceUp("eth0"); err != nil {
+		return fmt.Errorf("bring up eth0: %s", err)
+	}
+	if config.Gateway != "" {
+		if err := SetDefaultGateway(config.Gateway, "eth0"); err != nil {
+			return fmt.Errorf("set default gateway: %s", err)
+		}
+	}
+	return nil
+}
+
+func (v *veth) Destroy(config *Network, nspid int) error {
+	if config.Address != "" && config.Allocator != nil {
+		ip, _, err := net.ParseCIDR(config.Address)
+		if err != nil {
+			return fmt.Errorf("parse allocated address %s: %s", config.Address, err)
+		}
+		if err := config.Allocator.ReleaseIP(ip); err != nil {
+			return fmt.Errorf("release ip %s: %s", ip, err)
+		}
+	}
+	// The host end of the pair, and its namespaced peer, are destroyed
+	// automatically by the kernel once the container's network namespace
+	// goes away; there is nothing left on the host to remove.
+	return nil
+}
+
+func vethPairNames() (host, child string, err error) {
+	host, err = randomVethName()
+	if err != nil {
+		return "", "", err
+	}
+	child, err = randomVethName()
+	if err != nil {
+		return "", "", err
+	}
+	return host, child, nil
+}
+
+func randomVethName() (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("generate veth name: %s", err)
+	}
+	return fmt.Sprintf("veth%x", suffix), nil
+}